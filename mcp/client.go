@@ -0,0 +1,23 @@
+package mcp
+
+// Client是本包对外暴露的统一接口，client3EAlive/Pool/client4EAlive都实现了它，
+// 调用方因此可以在长连接、连接池、4E并发这几种连接管理方式之间自由切换，而
+// 不用改动任何读写调用的代码
+type Client interface {
+	// HealthCheck发送一次在线确认请求，用于探测PLC连接是否仍然可用
+	HealthCheck() error
+	// Read批量读取一段连续的字软元件
+	Read(deviceName string, offset, numPoints int64) ([]byte, error)
+	// BitRead批量读取一段连续的位软元件
+	BitRead(deviceName string, offset, numPoints int64) ([]byte, error)
+	// Write批量写入一段连续的软元件
+	Write(deviceName string, offset, numPoints int64, writeData []byte) ([]byte, error)
+	// RandomRead一次性读取若干互不相邻的字软元件和双字软元件
+	RandomRead(words, dwords []DevicePoint) ([]uint16, []uint32, error)
+	// RandomWrite一次性写入若干互不相邻的字软元件和双字软元件
+	RandomWrite(words map[DevicePoint]uint16, dwords map[DevicePoint]uint32) error
+	// MultiBlockRead一次性读取若干互不相邻的字区块和位区块
+	MultiBlockRead(wordBlocks, bitBlocks []BlockSpec) ([][]byte, [][]byte, error)
+	// Close关闭底层连接，释放所有相关资源
+	Close() error
+}
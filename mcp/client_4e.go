@@ -0,0 +1,334 @@
+package mcp
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrRequestTimeout在等待4E响应超过requestTimeout仍未收到回包时返回。此时对应
+// 的serial并不会被释放，避免PLC迟到的响应被误发给之后复用了这个serial的新请求
+var ErrRequestTimeout = errors.New("mcp: wait for 4E response timed out")
+
+// request4E是写goroutine要发送的一条待写帧
+type request4E struct {
+	payload []byte
+	replyCh chan response4E
+}
+
+// response4E是读goroutine按流水号分发给等待者的结果
+type response4E struct {
+	payload []byte
+	err     error
+}
+
+// client4EAlive实现基于MELSEC 4Eフレーム的MCP客户端。4E帧在请求头中携带一个
+// 调用方自选的2byte流水号，PLC会在响应中原样带回；借助这个流水号，同一条
+// TCP连接上可以让多个请求同时在途，不需要像client3EAlive那样用一把大锁把
+// 所有调用串行化。读写各由唯一一个goroutine负责，分别通过reqCh和流水号map
+// 与发起调用的goroutine通信。
+type client4EAlive struct {
+	tcpAddr *net.TCPAddr
+	stn     *station
+	codec   Codec
+
+	readTimeout    time.Duration
+	writeTimeout   time.Duration
+	requestTimeout time.Duration
+
+	reqCh chan request4E
+
+	mu         sync.Mutex
+	conn       net.Conn
+	nextSerial uint16
+	pending    map[uint16]chan response4E
+
+	closeOnce sync.Once
+	closeCh   chan struct{}
+}
+
+// Client4EOption用于在创建client4EAlive时配置可选参数
+type Client4EOption func(c *client4EAlive)
+
+// With4EReadTimeout设置读goroutine每次Read前SetReadDeadline使用的超时时间
+func With4EReadTimeout(d time.Duration) Client4EOption {
+	return func(c *client4EAlive) { c.readTimeout = d }
+}
+
+// With4EWriteTimeout设置写goroutine每次Write前SetWriteDeadline使用的超时时间
+func With4EWriteTimeout(d time.Duration) Client4EOption {
+	return func(c *client4EAlive) { c.writeTimeout = d }
+}
+
+// With4ERequestTimeout设置Read/BitRead/Write/HealthCheck等待对应响应的超时时间，
+// 0（默认值）表示一直等待，直到收到响应或连接被关闭
+func With4ERequestTimeout(d time.Duration) Client4EOption {
+	return func(c *client4EAlive) { c.requestTimeout = d }
+}
+
+// With4ECodec替换client4EAlive使用的Codec，默认是Binary4E
+func With4ECodec(codec Codec) Client4EOption {
+	return func(c *client4EAlive) { c.codec = codec }
+}
+
+// New4EAliveClient创建一个新的4E帧MCP客户端，连接建立后立即启动读写goroutine，
+// 支持同一条连接上并发发起多个Read/BitRead/Write/HealthCheck调用
+func New4EAliveClient(host string, port int, stn *station, opts ...Client4EOption) (Client, error) {
+	tcpAddr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf("%v:%v", host, port))
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.DialTCP("tcp", nil, tcpAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &client4EAlive{
+		tcpAddr: tcpAddr,
+		stn:     stn,
+		codec:   Binary4E{},
+		conn:    conn,
+		reqCh:   make(chan request4E),
+		pending: make(map[uint16]chan response4E),
+		closeCh: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	go c.writeLoop()
+	go c.readLoop()
+
+	return c, nil
+}
+
+// writeLoop是唯一从reqCh取待发帧并写入连接的goroutine，避免并发Write交织
+func (c *client4EAlive) writeLoop() {
+	for {
+		select {
+		case req := <-c.reqCh:
+			if err := c.conn.SetWriteDeadline(deadline(c.writeTimeout)); err != nil {
+				req.replyCh <- response4E{err: err}
+				continue
+			}
+			if _, err := c.conn.Write(req.payload); err != nil {
+				req.replyCh <- response4E{err: err}
+				continue
+			}
+		case <-c.closeCh:
+			return
+		}
+	}
+}
+
+// readLoop是唯一从连接读取响应的goroutine，按响应帧中的流水号把结果分发给
+// 正在等待的调用方；连接出错或关闭时，让所有仍在等待的调用方都收到该错误
+func (c *client4EAlive) readLoop() {
+	for {
+		if err := c.conn.SetReadDeadline(deadline(c.readTimeout)); err != nil {
+			c.failAllPending(err)
+			return
+		}
+
+		frame, err := c.codec.DecodeFrame(c.conn)
+		if err != nil {
+			c.failAllPending(err)
+			return
+		}
+
+		c.mu.Lock()
+		replyCh, ok := c.pending[frame.Serial]
+		if ok {
+			delete(c.pending, frame.Serial)
+		}
+		c.mu.Unlock()
+
+		if ok {
+			// EndCode非0是PLC对这一个请求的协议层面拒绝，连接本身仍然健康，
+			// 只回给这一个等待者一个错误，不调用failAllPending断开其它在途请求
+			if err := checkEndCode(frame); err != nil {
+				replyCh <- response4E{err: err}
+			} else {
+				replyCh <- response4E{payload: frame.Payload}
+			}
+		}
+	}
+}
+
+func (c *client4EAlive) failAllPending(err error) {
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = make(map[uint16]chan response4E)
+	c.mu.Unlock()
+
+	for _, replyCh := range pending {
+		replyCh <- response4E{err: err}
+	}
+}
+
+// allocateSerial分配一个当前没有在途请求占用的流水号：从nextSerial开始单调
+// 递增、溢出时回绕，跳过pending中仍在等待响应的流水号
+func (c *client4EAlive) allocateSerial(replyCh chan response4E) uint16 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for {
+		serial := c.nextSerial
+		c.nextSerial++
+		if _, inUse := c.pending[serial]; !inUse {
+			c.pending[serial] = replyCh
+			return serial
+		}
+	}
+}
+
+func (c *client4EAlive) releaseSerial(serial uint16) {
+	c.mu.Lock()
+	delete(c.pending, serial)
+	c.mu.Unlock()
+}
+
+// call分配流水号、用encode构建出对应serial的4E请求帧、提交给写goroutine，
+// 然后阻塞等待读goroutine回填的响应，直至收到、超时或连接关闭
+func (c *client4EAlive) call(encode func(serial uint16) ([]byte, error)) ([]byte, error) {
+	replyCh := make(chan response4E, 1)
+	serial := c.allocateSerial(replyCh)
+
+	payload, err := encode(serial)
+	if err != nil {
+		c.releaseSerial(serial)
+		return nil, err
+	}
+
+	select {
+	case c.reqCh <- request4E{payload: payload, replyCh: replyCh}:
+	case <-c.closeCh:
+		c.releaseSerial(serial)
+		return nil, io.ErrClosedPipe
+	}
+
+	var timeoutCh <-chan time.Time
+	if c.requestTimeout > 0 {
+		timer := time.NewTimer(c.requestTimeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+
+	select {
+	case resp := <-replyCh:
+		if resp.err != nil {
+			c.releaseSerial(serial)
+		}
+		return resp.payload, resp.err
+	case <-timeoutCh:
+		// 不在这里releaseSerial：PLC可能仍在处理这个serial对应的原始请求，
+		// 过早释放会让它被allocateSerial分配给新的调用方，readLoop随后把
+		// 迟到的响应错发给那个新调用方。超时后这个serial只在迟到的响应到达
+		// (readLoop把它从pending中删除)或连接出错/关闭(failAllPending清空
+		// pending)时才释放
+		return nil, ErrRequestTimeout
+	case <-c.closeCh:
+		c.releaseSerial(serial)
+		return nil, io.ErrClosedPipe
+	}
+}
+
+// HealthCheck实现Client接口的HealthCheck方法
+func (c *client4EAlive) HealthCheck() error {
+	payload, err := c.call(func(serial uint16) ([]byte, error) {
+		return c.codec.EncodeHealthCheck(c.stn, serial)
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(payload) != 7 {
+		return errors.New("plc connect test is fail: return length is [" + fmt.Sprintf("%X", payload) + "]")
+	}
+
+	// payload[0:2]是折返しデータ数[2byte]，应为5（小端0500）
+	if "0500" != fmt.Sprintf("%X", payload[0:2]) {
+		return errors.New("plc connect test is fail: return header is [" + fmt.Sprintf("%X", payload[0:2]) + "]")
+	}
+
+	//  折返しデータ[5byte]=ABCDE
+	if "4142434445" != fmt.Sprintf("%X", payload[2:7]) {
+		return errors.New("plc connect test is fail: return body is [" + fmt.Sprintf("%X", payload[2:7]) + "]")
+	}
+
+	return nil
+}
+
+// Read实现Client接口的Read方法
+func (c *client4EAlive) Read(deviceName string, offset, numPoints int64) ([]byte, error) {
+	return c.call(func(serial uint16) ([]byte, error) {
+		return c.codec.EncodeRead(c.stn, serial, deviceName, offset, numPoints)
+	})
+}
+
+// BitRead实现Client接口的BitRead方法
+func (c *client4EAlive) BitRead(deviceName string, offset, numPoints int64) ([]byte, error) {
+	return c.call(func(serial uint16) ([]byte, error) {
+		return c.codec.EncodeBitRead(c.stn, serial, deviceName, offset, numPoints)
+	})
+}
+
+// Write实现Client接口的Write方法
+func (c *client4EAlive) Write(deviceName string, offset, numPoints int64, writeData []byte) ([]byte, error) {
+	return c.call(func(serial uint16) ([]byte, error) {
+		return c.codec.EncodeWrite(c.stn, serial, deviceName, offset, numPoints, writeData)
+	})
+}
+
+// RandomRead实现Client接口的RandomRead方法，每条拆分请求各自走一次call分配的流水号
+func (c *client4EAlive) RandomRead(words, dwords []DevicePoint) ([]uint16, []uint32, error) {
+	return randomReadLoop(func(wChunk, dChunk []DevicePoint) ([]byte, error) {
+		return c.call(func(serial uint16) ([]byte, error) {
+			requestHex, err := c.stn.Build4ERandomReadRequest(serial, wChunk, dChunk)
+			if err != nil {
+				return nil, err
+			}
+			return hex.DecodeString(requestHex)
+		})
+	}, words, dwords)
+}
+
+// RandomWrite实现Client接口的RandomWrite方法，每条拆分请求各自走一次call分配的流水号
+func (c *client4EAlive) RandomWrite(words map[DevicePoint]uint16, dwords map[DevicePoint]uint32) error {
+	return randomWriteLoop(func(wChunk map[DevicePoint]uint16, dChunk map[DevicePoint]uint32) error {
+		_, err := c.call(func(serial uint16) ([]byte, error) {
+			requestHex, err := c.stn.Build4ERandomWriteRequest(serial, wChunk, dChunk)
+			if err != nil {
+				return nil, err
+			}
+			return hex.DecodeString(requestHex)
+		})
+		return err
+	}, words, dwords)
+}
+
+// MultiBlockRead实现Client接口的MultiBlockRead方法，每条拆分请求各自走一次call分配的流水号
+func (c *client4EAlive) MultiBlockRead(wordBlocks, bitBlocks []BlockSpec) ([][]byte, [][]byte, error) {
+	return multiBlockReadLoop(func(wChunk, bChunk []BlockSpec) ([]byte, error) {
+		return c.call(func(serial uint16) ([]byte, error) {
+			requestHex, err := c.stn.Build4EMultiBlockReadRequest(serial, wChunk, bChunk)
+			if err != nil {
+				return nil, err
+			}
+			return hex.DecodeString(requestHex)
+		})
+	}, wordBlocks, bitBlocks)
+}
+
+// Close关闭连接并唤醒所有仍在等待响应的调用方
+func (c *client4EAlive) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closeCh)
+	})
+	return c.conn.Close()
+}
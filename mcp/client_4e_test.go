@@ -0,0 +1,52 @@
+package mcp
+
+import "testing"
+
+func TestTo4EFrameHex(t *testing.T) {
+	// "5000"是3E请求的subheader，后面紧跟网络号/PC号等字节
+	req3E := "5000" + "00FF03FF000A0000" + "0401" + "0000960000A8130001"
+
+	got := to4EFrameHex(req3E, 0x0102)
+	want := "5400" + "0201" + "0000" + req3E[subheader3ERequestHexLen:]
+
+	if got != want {
+		t.Fatalf("to4EFrameHex结果不正确: got %s, want %s", got, want)
+	}
+}
+
+func TestClient4EAlive_AllocateSerial_SkipsInUse(t *testing.T) {
+	c := &client4EAlive{pending: make(map[uint16]chan response4E)}
+
+	chA := make(chan response4E, 1)
+	a := c.allocateSerial(chA)
+
+	chB := make(chan response4E, 1)
+	b := c.allocateSerial(chB)
+
+	if a == b {
+		t.Fatalf("两个仍在途的请求分配到了相同的流水号: %d", a)
+	}
+
+	c.releaseSerial(a)
+	if _, inUse := c.pending[a]; inUse {
+		t.Fatalf("releaseSerial之后流水号%d应当被释放", a)
+	}
+}
+
+func TestClient4EAlive_AllocateSerial_WrapsAround(t *testing.T) {
+	c := &client4EAlive{pending: make(map[uint16]chan response4E)}
+	c.nextSerial = 0xFFFF
+
+	// 0xFFFF和0都仍在途：allocateSerial必须越过0xFFFF回绕到0，再跳过0得到1
+	chOccupyingFFFF := make(chan response4E, 1)
+	c.pending[0xFFFF] = chOccupyingFFFF
+	chOccupying0 := make(chan response4E, 1)
+	c.pending[0] = chOccupying0
+
+	ch := make(chan response4E, 1)
+	serial := c.allocateSerial(ch)
+
+	if serial != 1 {
+		t.Fatalf("回绕后allocateSerial应当跳过仍在途的流水号0xFFFF和0，得到1, got %d", serial)
+	}
+}
@@ -1,11 +1,11 @@
 package mcp
 
 import (
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"net"
 	"sync"
+	"time"
 )
 
 type client3EAlive struct {
@@ -14,8 +14,67 @@ type client3EAlive struct {
 	tcpAddr *net.TCPAddr
 	// PLC station
 	stn *station
+	// codec负责请求编码/应答解码，默认是Binary3E，可以换成ASCII3E
+	codec Codec
 	// 用于保护并发访问
 	mu sync.Mutex
+	// 每次I/O前施加的读写超时，0表示不设置超时
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+}
+
+// ClientOption用于在创建client3EAlive时配置可选参数
+type ClientOption func(c *client3EAlive)
+
+// WithReadTimeout设置每次Read调用前conn.SetReadDeadline使用的超时时间，
+// 避免连接半开（对端已消失但TCP连接未感知到）时Read无限期阻塞
+func WithReadTimeout(d time.Duration) ClientOption {
+	return func(c *client3EAlive) {
+		c.readTimeout = d
+	}
+}
+
+// WithWriteTimeout设置每次Write调用前conn.SetWriteDeadline使用的超时时间
+func WithWriteTimeout(d time.Duration) ClientOption {
+	return func(c *client3EAlive) {
+		c.writeTimeout = d
+	}
+}
+
+// WithCodec替换client3EAlive使用的Codec，默认是Binary3E。ASCII3E只实现了
+// DecodeFrame，它的EncodeX方法都返回errASCII3EEncodeNotImplemented，因此传入
+// ASCII3E时HealthCheck/Read/BitRead/Write都会返回这个错误
+func WithCodec(codec Codec) ClientOption {
+	return func(c *client3EAlive) {
+		c.codec = codec
+	}
+}
+
+// deadline根据timeout计算SetReadDeadline/SetWriteDeadline应使用的time.Time，
+// timeout为0时返回零值time.Time，表示不设置超时
+func deadline(timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
+}
+
+// writeFrame在写入payload前按writeTimeout设置写超时
+func (c *client3EAlive) writeFrame(conn net.Conn, payload []byte) error {
+	if err := conn.SetWriteDeadline(deadline(c.writeTimeout)); err != nil {
+		return err
+	}
+	_, err := conn.Write(payload)
+	return err
+}
+
+// readFrame在读取响应前按readTimeout设置读超时，并委托codec完整地拼出一帧
+// 响应，不会因为TCP粘包/半包而截断或多读
+func (c *client3EAlive) readFrame(conn net.Conn) (Frame, error) {
+	if err := conn.SetReadDeadline(deadline(c.readTimeout)); err != nil {
+		return Frame{}, err
+	}
+	return c.codec.DecodeFrame(conn)
 }
 
 // 获取连接，如果连接不存在或已关闭则重新创建
@@ -58,10 +117,7 @@ func (c *client3EAlive) Close() error {
 
 // HealthCheck实现Client接口的HealthCheck方法
 func (c *client3EAlive) HealthCheck() error {
-	requestStr := c.stn.BuildHealthCheckRequest()
-
-	// 二进制协议
-	payload, err := hex.DecodeString(requestStr)
+	payload, err := c.codec.EncodeHealthCheck(c.stn, 0)
 	if err != nil {
 		return err
 	}
@@ -72,7 +128,7 @@ func (c *client3EAlive) HealthCheck() error {
 	}
 
 	// 发送消息
-	if _, err = conn.Write(payload); err != nil {
+	if err = c.writeFrame(conn, payload); err != nil {
 		// 连接可能已断开，下一次操作会重新创建
 		c.mu.Lock()
 		c.conn.Close()
@@ -82,8 +138,7 @@ func (c *client3EAlive) HealthCheck() error {
 	}
 
 	// 接收消息
-	readBuff := make([]byte, 30)
-	readLen, err := conn.Read(readBuff)
+	frame, err := c.readFrame(conn)
 	if err != nil {
 		// 连接可能已断开，下一次操作会重新创建
 		c.mu.Lock()
@@ -93,20 +148,22 @@ func (c *client3EAlive) HealthCheck() error {
 		return err
 	}
 
-	resp := readBuff[:readLen]
+	if err := checkEndCode(frame); err != nil {
+		return err
+	}
 
-	if readLen != 18 {
-		return errors.New("plc connect test is fail: return length is [" + fmt.Sprintf("%X", resp) + "]")
+	if len(frame.Payload) != 7 {
+		return errors.New("plc connect test is fail: return length is [" + fmt.Sprintf("%X", frame.Payload) + "]")
 	}
 
 	// decodeString is 折返しデータ数ヘッダ[1byte]
-	if "0500" != fmt.Sprintf("%X", resp[11:13]) {
-		return errors.New("plc connect test is fail: return header is [" + fmt.Sprintf("%X", resp[11:13]) + "]")
+	if "0500" != fmt.Sprintf("%X", frame.Payload[0:2]) {
+		return errors.New("plc connect test is fail: return header is [" + fmt.Sprintf("%X", frame.Payload[0:2]) + "]")
 	}
 
 	//  折返しデータ[5byte]=ABCDE
-	if "4142434445" != fmt.Sprintf("%X", resp[13:18]) {
-		return errors.New("plc connect test is fail: return body is [" + fmt.Sprintf("%X", resp[13:18]) + "]")
+	if "4142434445" != fmt.Sprintf("%X", frame.Payload[2:7]) {
+		return errors.New("plc connect test is fail: return body is [" + fmt.Sprintf("%X", frame.Payload[2:7]) + "]")
 	}
 
 	return nil
@@ -114,10 +171,7 @@ func (c *client3EAlive) HealthCheck() error {
 
 // Read实现Client接口的Read方法
 func (c *client3EAlive) Read(deviceName string, offset, numPoints int64) ([]byte, error) {
-	requestStr := c.stn.BuildReadRequest(deviceName, offset, numPoints)
-
-	// 二进制协议
-	payload, err := hex.DecodeString(requestStr)
+	payload, err := c.codec.EncodeRead(c.stn, 0, deviceName, offset, numPoints)
 	if err != nil {
 		return nil, err
 	}
@@ -128,7 +182,7 @@ func (c *client3EAlive) Read(deviceName string, offset, numPoints int64) ([]byte
 	}
 
 	// 发送消息
-	if _, err = conn.Write(payload); err != nil {
+	if err = c.writeFrame(conn, payload); err != nil {
 		// 连接可能已断开，下一次操作会重新创建
 		c.mu.Lock()
 		c.conn.Close()
@@ -138,8 +192,7 @@ func (c *client3EAlive) Read(deviceName string, offset, numPoints int64) ([]byte
 	}
 
 	// 接收消息
-	readBuff := make([]byte, 22+2*numPoints) // 22是响应头大小
-	readLen, err := conn.Read(readBuff)
+	frame, err := c.readFrame(conn)
 	if err != nil {
 		// 连接可能已断开，下一次操作会重新创建
 		c.mu.Lock()
@@ -149,15 +202,18 @@ func (c *client3EAlive) Read(deviceName string, offset, numPoints int64) ([]byte
 		return nil, err
 	}
 
-	return readBuff[:readLen], nil
+	// EndCode非0是PLC对这次请求的协议层面拒绝，连接本身仍然健康，不走上面
+	// 的重连逻辑
+	if err := checkEndCode(frame); err != nil {
+		return nil, err
+	}
+
+	return frame.Payload, nil
 }
 
 // BitRead实现Client接口的BitRead方法
 func (c *client3EAlive) BitRead(deviceName string, offset, numPoints int64) ([]byte, error) {
-	requestStr := c.stn.BuildBitReadRequest(deviceName, offset, numPoints)
-
-	// 二进制协议
-	payload, err := hex.DecodeString(requestStr)
+	payload, err := c.codec.EncodeBitRead(c.stn, 0, deviceName, offset, numPoints)
 	if err != nil {
 		return nil, err
 	}
@@ -168,7 +224,7 @@ func (c *client3EAlive) BitRead(deviceName string, offset, numPoints int64) ([]b
 	}
 
 	// 发送消息
-	if _, err = conn.Write(payload); err != nil {
+	if err = c.writeFrame(conn, payload); err != nil {
 		// 连接可能已断开，下一次操作会重新创建
 		c.mu.Lock()
 		c.conn.Close()
@@ -178,8 +234,7 @@ func (c *client3EAlive) BitRead(deviceName string, offset, numPoints int64) ([]b
 	}
 
 	// 接收消息
-	readBuff := make([]byte, 22+2*numPoints) // 22是响应头大小
-	readLen, err := conn.Read(readBuff)
+	frame, err := c.readFrame(conn)
 	if err != nil {
 		// 连接可能已断开，下一次操作会重新创建
 		c.mu.Lock()
@@ -189,15 +244,18 @@ func (c *client3EAlive) BitRead(deviceName string, offset, numPoints int64) ([]b
 		return nil, err
 	}
 
-	return readBuff[:readLen], nil
+	// EndCode非0是PLC对这次请求的协议层面拒绝，连接本身仍然健康，不走上面
+	// 的重连逻辑
+	if err := checkEndCode(frame); err != nil {
+		return nil, err
+	}
+
+	return frame.Payload, nil
 }
 
 // Write实现Client接口的Write方法
 func (c *client3EAlive) Write(deviceName string, offset, numPoints int64, writeData []byte) ([]byte, error) {
-	requestStr := c.stn.BuildWriteRequest(deviceName, offset, numPoints, writeData)
-
-	// 二进制协议
-	payload, err := hex.DecodeString(requestStr)
+	payload, err := c.codec.EncodeWrite(c.stn, 0, deviceName, offset, numPoints, writeData)
 	if err != nil {
 		return nil, err
 	}
@@ -208,7 +266,7 @@ func (c *client3EAlive) Write(deviceName string, offset, numPoints int64, writeD
 	}
 
 	// 发送消息
-	if _, err = conn.Write(payload); err != nil {
+	if err = c.writeFrame(conn, payload); err != nil {
 		// 连接可能已断开，下一次操作会重新创建
 		c.mu.Lock()
 		c.conn.Close()
@@ -218,8 +276,7 @@ func (c *client3EAlive) Write(deviceName string, offset, numPoints int64, writeD
 	}
 
 	// 接收消息
-	readBuff := make([]byte, 22) // 22是响应头大小
-	readLen, err := conn.Read(readBuff)
+	frame, err := c.readFrame(conn)
 	if err != nil {
 		// 连接可能已断开，下一次操作会重新创建
 		c.mu.Lock()
@@ -229,14 +286,24 @@ func (c *client3EAlive) Write(deviceName string, offset, numPoints int64, writeD
 		return nil, err
 	}
 
-	return readBuff[:readLen], nil
+	// EndCode非0是PLC对这次请求的协议层面拒绝，连接本身仍然健康，不走上面
+	// 的重连逻辑
+	if err := checkEndCode(frame); err != nil {
+		return nil, err
+	}
+
+	return frame.Payload, nil
 }
 
 // New3EAliveClient创建一个新的保持长连接的3E帧MCP客户端
-func New3EAliveClient(host string, port int, stn *station) (Client, error) {
+func New3EAliveClient(host string, port int, stn *station, opts ...ClientOption) (Client, error) {
 	tcpAddr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf("%v:%v", host, port))
 	if err != nil {
 		return nil, err
 	}
-	return &client3EAlive{tcpAddr: tcpAddr, stn: stn}, nil
+	c := &client3EAlive{tcpAddr: tcpAddr, stn: stn, codec: Binary3E{}}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
 }
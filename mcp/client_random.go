@@ -0,0 +1,280 @@
+package mcp
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// errNotEnoughData在响应payload比按请求点位/区块数推算出的长度更短时返回
+func errNotEnoughData(want, got int) error {
+	return fmt.Errorf("mcp: response payload too short: want at least %d bytes, got %d", want, got)
+}
+
+// doRandomRequest是RandomRead/RandomWrite共用的发送/接收逻辑：编码好的hex请求
+// 经由getConnection取到的连接发送，用codec.DecodeFrame读出一帧完整响应
+func (c *client3EAlive) doRandomRequest(requestHex string) ([]byte, error) {
+	payload, err := hex.DecodeString(requestHex)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := c.getConnection()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = c.writeFrame(conn, payload); err != nil {
+		c.mu.Lock()
+		c.conn.Close()
+		c.conn = nil
+		c.mu.Unlock()
+		return nil, err
+	}
+
+	frame, err := c.readFrame(conn)
+	if err != nil {
+		c.mu.Lock()
+		c.conn.Close()
+		c.conn = nil
+		c.mu.Unlock()
+		return nil, err
+	}
+
+	if err := checkEndCode(frame); err != nil {
+		return nil, err
+	}
+
+	return frame.Payload, nil
+}
+
+// randomReadRoundTrip发送一次已经按maxRandomPoints拆分好的随机读请求并返回
+// 其payload，屏蔽client3EAlive/Pool/client4EAlive各自不同的连接管理方式
+type randomReadRoundTrip func(wChunk, dChunk []DevicePoint) ([]byte, error)
+
+// randomWriteRoundTrip同randomReadRoundTrip，用于随机写
+type randomWriteRoundTrip func(wChunk map[DevicePoint]uint16, dChunk map[DevicePoint]uint32) error
+
+// multiBlockReadRoundTrip同randomReadRoundTrip，用于多区块批量读
+type multiBlockReadRoundTrip func(wChunk, bChunk []BlockSpec) ([]byte, error)
+
+// randomReadLoop是RandomRead的公共实现：按maxRandomPoints把words/dwords拆分成
+// 多条请求，依次交给rt发送，再把各批结果按输入顺序拼接起来
+func randomReadLoop(rt randomReadRoundTrip, words, dwords []DevicePoint) ([]uint16, []uint32, error) {
+	wordResults := make([]uint16, 0, len(words))
+	dwordResults := make([]uint32, 0, len(dwords))
+
+	wi, di := 0, 0
+	for wi < len(words) || di < len(dwords) {
+		wChunk, dChunk, wNext, dNext := takeWeightedDevicePoints(words, dwords, wi, di, maxRandomPoints)
+		wi, di = wNext, dNext
+
+		payload, err := rt(wChunk, dChunk)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		ws, ds, err := decodeRandomReadPayload(payload, len(wChunk), len(dChunk))
+		if err != nil {
+			return nil, nil, err
+		}
+		wordResults = append(wordResults, ws...)
+		dwordResults = append(dwordResults, ds...)
+	}
+
+	return wordResults, dwordResults, nil
+}
+
+// RandomRead实现Client接口的RandomRead方法（命令0403）：一次请求里同时读取
+// 若干互不相邻的字软元件(words)和双字软元件(dwords)。超过maxRandomPoints个
+// 点位时会被透明地拆分成多条顺序请求，并把结果按输入顺序拼接回来
+func (c *client3EAlive) RandomRead(words, dwords []DevicePoint) ([]uint16, []uint32, error) {
+	return randomReadLoop(func(wChunk, dChunk []DevicePoint) ([]byte, error) {
+		requestHex, err := c.stn.BuildRandomReadRequest(wChunk, dChunk)
+		if err != nil {
+			return nil, err
+		}
+		return c.doRandomRequest(requestHex)
+	}, words, dwords)
+}
+
+// takeDevicePoints从points[from:]里最多取n个点位，返回取到的切片以及下一次
+// 应该从哪个下标继续
+func takeDevicePoints(points []DevicePoint, from, n int) ([]DevicePoint, int) {
+	if n <= 0 || from >= len(points) {
+		return nil, from
+	}
+	to := from + n
+	if to > len(points) {
+		to = len(points)
+	}
+	return points[from:to], to
+}
+
+// takeWeightedDevicePoints按maxRandomPoints的点数限制从words/dwords中各取一段：
+// 字点位权重1，双字点位权重dwordPointWeight(2)，保证len(wChunk)+2*len(dChunk)
+// 不超过maxPoints，使拆分后的每条请求都不会超出PLC的随机读/写点数上限
+func takeWeightedDevicePoints(words, dwords []DevicePoint, wi, di, maxPoints int) (wChunk, dChunk []DevicePoint, wNext, dNext int) {
+	wChunk, wNext = takeDevicePoints(words, wi, maxPoints)
+	remaining := (maxPoints - len(wChunk)) / dwordPointWeight
+	dChunk, dNext = takeDevicePoints(dwords, di, remaining)
+	return wChunk, dChunk, wNext, dNext
+}
+
+// decodeRandomReadPayload把RandomRead响应的payload按"先全部word，再全部dword"
+// 的顺序切成[]uint16和[]uint32
+func decodeRandomReadPayload(payload []byte, numWords, numDwords int) ([]uint16, []uint32, error) {
+	want := numWords*2 + numDwords*4
+	if len(payload) < want {
+		return nil, nil, errNotEnoughData(want, len(payload))
+	}
+
+	words := make([]uint16, numWords)
+	for i := 0; i < numWords; i++ {
+		off := i * 2
+		words[i] = uint16(payload[off]) | uint16(payload[off+1])<<8
+	}
+
+	dwords := make([]uint32, numDwords)
+	base := numWords * 2
+	for i := 0; i < numDwords; i++ {
+		off := base + i*4
+		dwords[i] = uint32(payload[off]) | uint32(payload[off+1])<<8 | uint32(payload[off+2])<<16 | uint32(payload[off+3])<<24
+	}
+
+	return words, dwords, nil
+}
+
+// randomWriteLoop是RandomWrite的公共实现：按maxRandomPoints把words/dwords拆分
+// 成多条请求，依次交给rt发送
+func randomWriteLoop(rt randomWriteRoundTrip, words map[DevicePoint]uint16, dwords map[DevicePoint]uint32) error {
+	wordList := make([]DevicePoint, 0, len(words))
+	for dp := range words {
+		wordList = append(wordList, dp)
+	}
+	dwordList := make([]DevicePoint, 0, len(dwords))
+	for dp := range dwords {
+		dwordList = append(dwordList, dp)
+	}
+
+	wi, di := 0, 0
+	for wi < len(wordList) || di < len(dwordList) {
+		wChunk, dChunk, wNext, dNext := takeWeightedDevicePoints(wordList, dwordList, wi, di, maxRandomPoints)
+		wi, di = wNext, dNext
+
+		wordChunk := make(map[DevicePoint]uint16, len(wChunk))
+		for _, dp := range wChunk {
+			wordChunk[dp] = words[dp]
+		}
+		dwordChunk := make(map[DevicePoint]uint32, len(dChunk))
+		for _, dp := range dChunk {
+			dwordChunk[dp] = dwords[dp]
+		}
+
+		if err := rt(wordChunk, dwordChunk); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RandomWrite实现Client接口的RandomWrite方法（命令1402）：一次请求里同时写入
+// 若干互不相邻的字软元件和双字软元件，超过maxRandomPoints个点位时透明拆分成
+// 多条顺序请求
+func (c *client3EAlive) RandomWrite(words map[DevicePoint]uint16, dwords map[DevicePoint]uint32) error {
+	return randomWriteLoop(func(wChunk map[DevicePoint]uint16, dChunk map[DevicePoint]uint32) error {
+		requestHex, err := c.stn.BuildRandomWriteRequest(wChunk, dChunk)
+		if err != nil {
+			return err
+		}
+		_, err = c.doRandomRequest(requestHex)
+		return err
+	}, words, dwords)
+}
+
+// multiBlockReadLoop是MultiBlockRead的公共实现：按maxMultiBlockCount把
+// wordBlocks/bitBlocks拆分成多条请求，依次交给rt发送，再把各批结果按输入
+// 顺序拼接起来
+func multiBlockReadLoop(rt multiBlockReadRoundTrip, wordBlocks, bitBlocks []BlockSpec) ([][]byte, [][]byte, error) {
+	wordResults := make([][]byte, 0, len(wordBlocks))
+	bitResults := make([][]byte, 0, len(bitBlocks))
+
+	wi, bi := 0, 0
+	for wi < len(wordBlocks) || bi < len(bitBlocks) {
+		wChunk, wNext := takeBlockSpecs(wordBlocks, wi, maxMultiBlockCount)
+		remaining := maxMultiBlockCount - len(wChunk)
+		bChunk, bNext := takeBlockSpecs(bitBlocks, bi, remaining)
+		wi, bi = wNext, bNext
+
+		payload, err := rt(wChunk, bChunk)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		ws, bs, err := decodeMultiBlockReadPayload(payload, wChunk, bChunk)
+		if err != nil {
+			return nil, nil, err
+		}
+		wordResults = append(wordResults, ws...)
+		bitResults = append(bitResults, bs...)
+	}
+
+	return wordResults, bitResults, nil
+}
+
+// MultiBlockRead实现Client接口的MultiBlockRead方法（命令0406）：一次请求里
+// 同时读取若干互不相邻的字区块(wordBlocks)和位区块(bitBlocks)，超过
+// maxMultiBlockCount个区块时透明拆分成多条顺序请求。返回值按输入顺序逐区块
+// 给出原始字节
+func (c *client3EAlive) MultiBlockRead(wordBlocks, bitBlocks []BlockSpec) ([][]byte, [][]byte, error) {
+	return multiBlockReadLoop(func(wChunk, bChunk []BlockSpec) ([]byte, error) {
+		requestHex, err := c.stn.BuildMultiBlockReadRequest(wChunk, bChunk)
+		if err != nil {
+			return nil, err
+		}
+		return c.doRandomRequest(requestHex)
+	}, wordBlocks, bitBlocks)
+}
+
+// takeBlockSpecs从blocks[from:]里最多取n个区块，返回取到的切片以及下一次
+// 应该从哪个下标继续
+func takeBlockSpecs(blocks []BlockSpec, from, n int) ([]BlockSpec, int) {
+	if n <= 0 || from >= len(blocks) {
+		return nil, from
+	}
+	to := from + n
+	if to > len(blocks) {
+		to = len(blocks)
+	}
+	return blocks[from:to], to
+}
+
+// decodeMultiBlockReadPayload按wordBlocks/bitBlocks声明的长度，把响应payload
+// 依次切成每个区块各自的原始字节。多区块批量读(0406)请求是以字单位子命令
+// 0000发送的（见multiBlockReadBody/build3ERequestHex），这个单位对wordBlocks
+// 和bitBlocks同样生效：位区块也是逐点按1个字(2byte)返回，而不是批量位读那种
+// 2点压缩进1byte的格式，因此两种区块都占NumPoints*2字节
+func decodeMultiBlockReadPayload(payload []byte, wordBlocks, bitBlocks []BlockSpec) ([][]byte, [][]byte, error) {
+	words := make([][]byte, 0, len(wordBlocks))
+	offset := 0
+	for _, b := range wordBlocks {
+		n := int(b.NumPoints) * 2
+		if offset+n > len(payload) {
+			return nil, nil, errNotEnoughData(offset+n, len(payload))
+		}
+		words = append(words, payload[offset:offset+n])
+		offset += n
+	}
+
+	bits := make([][]byte, 0, len(bitBlocks))
+	for _, b := range bitBlocks {
+		n := int(b.NumPoints) * 2
+		if offset+n > len(payload) {
+			return nil, nil, errNotEnoughData(offset+n, len(payload))
+		}
+		bits = append(bits, payload[offset:offset+n])
+		offset += n
+	}
+
+	return words, bits, nil
+}
@@ -0,0 +1,94 @@
+package mcp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTakeDevicePoints(t *testing.T) {
+	points := []DevicePoint{{Device: "D", Offset: 0}, {Device: "D", Offset: 1}, {Device: "D", Offset: 2}}
+
+	chunk, next := takeDevicePoints(points, 0, 2)
+	if len(chunk) != 2 || next != 2 {
+		t.Fatalf("期望取到前2个点位且next=2, got chunk=%v next=%d", chunk, next)
+	}
+
+	chunk, next = takeDevicePoints(points, 2, 2)
+	if len(chunk) != 1 || next != 3 {
+		t.Fatalf("期望取到剩余1个点位且next=3, got chunk=%v next=%d", chunk, next)
+	}
+
+	chunk, next = takeDevicePoints(points, 3, 2)
+	if chunk != nil || next != 3 {
+		t.Fatalf("越界时应当返回空切片且next不变, got chunk=%v next=%d", chunk, next)
+	}
+}
+
+func TestDecodeRandomReadPayload(t *testing.T) {
+	// 2个word(0x0001, 0x0002) + 1个dword(0x00030004)
+	payload := []byte{0x01, 0x00, 0x02, 0x00, 0x04, 0x00, 0x03, 0x00}
+
+	words, dwords, err := decodeRandomReadPayload(payload, 2, 1)
+	if err != nil {
+		t.Fatalf("decodeRandomReadPayload返回错误: %v", err)
+	}
+	if !(words[0] == 1 && words[1] == 2) {
+		t.Fatalf("words解析不正确: got %v", words)
+	}
+	if dwords[0] != 0x00030004 {
+		t.Fatalf("dwords解析不正确: got %X", dwords[0])
+	}
+}
+
+func TestDecodeRandomReadPayload_TooShort(t *testing.T) {
+	if _, _, err := decodeRandomReadPayload([]byte{0x01}, 2, 0); err == nil {
+		t.Fatalf("payload不足时应当返回错误")
+	}
+}
+
+func TestDecodeMultiBlockReadPayload(t *testing.T) {
+	wordBlocks := []BlockSpec{{Device: "D", Offset: 0, NumPoints: 2}}
+	bitBlocks := []BlockSpec{{Device: "M", Offset: 0, NumPoints: 3}}
+
+	// word区块: 2点 * 2byte = 4byte；bit区块同样以字单位返回: 3点 * 2byte = 6byte
+	payload := []byte{0xAA, 0xBB, 0xCC, 0xDD, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0A}
+
+	words, bits, err := decodeMultiBlockReadPayload(payload, wordBlocks, bitBlocks)
+	if err != nil {
+		t.Fatalf("decodeMultiBlockReadPayload返回错误: %v", err)
+	}
+	if !bytes.Equal(words[0], []byte{0xAA, 0xBB, 0xCC, 0xDD}) {
+		t.Fatalf("word区块解析不正确: got %X", words[0])
+	}
+	if !bytes.Equal(bits[0], []byte{0x05, 0x06, 0x07, 0x08, 0x09, 0x0A}) {
+		t.Fatalf("bit区块解析不正确: got %X", bits[0])
+	}
+}
+
+func TestEncodeDevicePoint(t *testing.T) {
+	got, err := encodeDevicePoint(DevicePoint{Device: "D", Offset: 0x010203})
+	if err != nil {
+		t.Fatalf("encodeDevicePoint返回错误: %v", err)
+	}
+	want := []byte{0x03, 0x02, 0x01, 0xA8}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("encodeDevicePoint结果不正确: got %X, want %X", got, want)
+	}
+}
+
+func TestEncodeDevicePoint_UnsupportedDevice(t *testing.T) {
+	if _, err := encodeDevicePoint(DevicePoint{Device: "ZZ", Offset: 0}); err == nil {
+		t.Fatalf("不支持的软元件应当返回错误")
+	}
+}
+
+func TestEncodeBlockSpec(t *testing.T) {
+	got, err := encodeBlockSpec(BlockSpec{Device: "M", Offset: 0x000010, NumPoints: 0x0203})
+	if err != nil {
+		t.Fatalf("encodeBlockSpec返回错误: %v", err)
+	}
+	want := []byte{0x10, 0x00, 0x00, 0x90, 0x03, 0x02}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("encodeBlockSpec结果不正确: got %X, want %X", got, want)
+	}
+}
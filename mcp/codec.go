@@ -0,0 +1,198 @@
+package mcp
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// endCodeLen是3E/4E応答フレーム中，紧跟在前缀之后的终止代码（正常结束为0000，
+// 异常结束为非0错误码）所占的字节数
+const endCodeLen = 2
+
+// Frame是Codec.DecodeFrame解出的一帧应答，屏蔽了3E/4E/二进制/ASCII各自的帧格式差异
+type Frame struct {
+	// Serial是4E帧中由客户端分配、PLC原样带回的流水号；3E/ASCII3E没有这个字段，恒为0
+	Serial uint16
+	// EndCode是PLC返回的终止代码，0表示正常结束，非0为异常结束代码
+	EndCode uint16
+	// Payload是终止代码之后的数据部分
+	Payload []byte
+}
+
+// Codec把MC协议的请求编码、应答解码从client3EAlive/client4EAlive/Pool中剥离出来，
+// 使这些client只负责连接管理和读写调度，不关心具体是二进制帧还是ASCII帧。
+// RandomRead/RandomWrite/MultiBlockRead的请求不经过Codec编码，始终由station的
+// 二进制帧构造器生成，只有应答解码走Codec.DecodeFrame
+type Codec interface {
+	EncodeRead(stn *station, serial uint16, deviceName string, offset, numPoints int64) ([]byte, error)
+	EncodeBitRead(stn *station, serial uint16, deviceName string, offset, numPoints int64) ([]byte, error)
+	EncodeWrite(stn *station, serial uint16, deviceName string, offset, numPoints int64, writeData []byte) ([]byte, error)
+	EncodeHealthCheck(stn *station, serial uint16) ([]byte, error)
+	DecodeFrame(r io.Reader) (Frame, error)
+}
+
+// EndCodeError表示PLC以非0终止代码应答，即协议层面拒绝/失败了这次请求，
+// 和连接断开等I/O错误是两回事：连接本身仍然健康，不应触发重连/剔除/断开重连
+type EndCodeError struct {
+	EndCode uint16
+}
+
+func (e *EndCodeError) Error() string {
+	return fmt.Sprintf("mcp: plc returned abnormal end code %04X", e.EndCode)
+}
+
+// checkEndCode在frame.EndCode非0时返回*EndCodeError，调用方应当在I/O成功、
+// 帧被完整解出之后、使用frame.Payload之前做这个检查
+func checkEndCode(frame Frame) error {
+	if frame.EndCode != 0 {
+		return &EndCodeError{EndCode: frame.EndCode}
+	}
+	return nil
+}
+
+// splitBinaryFrame把readResponseFrame/readResponse4EFrame拼出的完整帧，从
+// 前缀之后切分成终止代码和数据两部分
+func splitBinaryFrame(frame []byte, prefixLen int) (endCode uint16, payload []byte, err error) {
+	if len(frame) < prefixLen+endCodeLen {
+		return 0, nil, errors.New("mcp: response frame too short")
+	}
+	endCode = binary.LittleEndian.Uint16(frame[prefixLen : prefixLen+endCodeLen])
+	payload = frame[prefixLen+endCodeLen:]
+	return endCode, payload, nil
+}
+
+// Binary3E是MELSEC 3Eフレームの二进制编码实现，即本包原先唯一支持的协议
+type Binary3E struct{}
+
+func (Binary3E) EncodeRead(stn *station, _ uint16, deviceName string, offset, numPoints int64) ([]byte, error) {
+	return hex.DecodeString(stn.BuildReadRequest(deviceName, offset, numPoints))
+}
+
+func (Binary3E) EncodeBitRead(stn *station, _ uint16, deviceName string, offset, numPoints int64) ([]byte, error) {
+	return hex.DecodeString(stn.BuildBitReadRequest(deviceName, offset, numPoints))
+}
+
+func (Binary3E) EncodeWrite(stn *station, _ uint16, deviceName string, offset, numPoints int64, writeData []byte) ([]byte, error) {
+	return hex.DecodeString(stn.BuildWriteRequest(deviceName, offset, numPoints, writeData))
+}
+
+func (Binary3E) EncodeHealthCheck(stn *station, _ uint16) ([]byte, error) {
+	return hex.DecodeString(stn.BuildHealthCheckRequest())
+}
+
+func (Binary3E) DecodeFrame(r io.Reader) (Frame, error) {
+	frame, err := readResponseFrame(r)
+	if err != nil {
+		return Frame{}, err
+	}
+	endCode, payload, err := splitBinaryFrame(frame, responsePrefixLen)
+	if err != nil {
+		return Frame{}, err
+	}
+	return Frame{EndCode: endCode, Payload: payload}, nil
+}
+
+// Binary4E是MELSEC 4Eフレームの二进制编码实现，相比Binary3E在请求/应答中多携带
+// 一个由客户端分配的流水号serial，使同一条连接上的多个请求可以并发在途
+type Binary4E struct{}
+
+func (Binary4E) EncodeRead(stn *station, serial uint16, deviceName string, offset, numPoints int64) ([]byte, error) {
+	return hex.DecodeString(stn.Build4EReadRequest(serial, deviceName, offset, numPoints))
+}
+
+func (Binary4E) EncodeBitRead(stn *station, serial uint16, deviceName string, offset, numPoints int64) ([]byte, error) {
+	return hex.DecodeString(stn.Build4EBitReadRequest(serial, deviceName, offset, numPoints))
+}
+
+func (Binary4E) EncodeWrite(stn *station, serial uint16, deviceName string, offset, numPoints int64, writeData []byte) ([]byte, error) {
+	return hex.DecodeString(stn.Build4EWriteRequest(serial, deviceName, offset, numPoints, writeData))
+}
+
+func (Binary4E) EncodeHealthCheck(stn *station, serial uint16) ([]byte, error) {
+	return hex.DecodeString(stn.Build4EHealthCheckRequest(serial))
+}
+
+func (Binary4E) DecodeFrame(r io.Reader) (Frame, error) {
+	serial, frame, err := readResponse4EFrame(r)
+	if err != nil {
+		return Frame{}, err
+	}
+	endCode, payload, err := splitBinaryFrame(frame, response4EPrefixLen)
+	if err != nil {
+		return Frame{}, err
+	}
+	return Frame{Serial: serial, EndCode: endCode, Payload: payload}, nil
+}
+
+// asciiResponsePrefixLen是ASCII模式下应答前缀占用的字符数：二进制模式每个字节
+// 在ASCII模式下表示为2个十六进制字符
+const asciiResponsePrefixLen = responsePrefixLen * 2
+
+// errASCII3EEncodeNotImplemented由ASCII3E的EncodeX方法返回：MC ASCIIモード的
+// 请求并不是二进制帧原样转成hex文本（软元件名称、地址位宽、字段顺序都不同），
+// 而本包目前只有Binary3E/Binary4E这两套二进制帧的请求构造器，没有一套真正
+// 按ASCII模式格式组装请求的实现，所以这里如实报错，而不是拼出一个在线路上
+// 无效的请求
+var errASCII3EEncodeNotImplemented = errors.New("mcp: ASCII3E request encoding is not implemented, only DecodeFrame is supported")
+
+// ASCII3E是MCプロトコルのASCIIモード解码实现：目前只支持解析ASCIIモード应答
+// (DecodeFrame)，帧结构与Binary3E一致，只是每个字节在线路上多了一层hex文本
+// 编码。请求编码(EncodeX)尚未实现，见errASCII3EEncodeNotImplemented
+type ASCII3E struct{}
+
+func (ASCII3E) EncodeRead(stn *station, _ uint16, deviceName string, offset, numPoints int64) ([]byte, error) {
+	return nil, errASCII3EEncodeNotImplemented
+}
+
+func (ASCII3E) EncodeBitRead(stn *station, _ uint16, deviceName string, offset, numPoints int64) ([]byte, error) {
+	return nil, errASCII3EEncodeNotImplemented
+}
+
+func (ASCII3E) EncodeWrite(stn *station, _ uint16, deviceName string, offset, numPoints int64, writeData []byte) ([]byte, error) {
+	return nil, errASCII3EEncodeNotImplemented
+}
+
+func (ASCII3E) EncodeHealthCheck(stn *station, _ uint16) ([]byte, error) {
+	return nil, errASCII3EEncodeNotImplemented
+}
+
+func (ASCII3E) DecodeFrame(r io.Reader) (Frame, error) {
+	asciiPrefix := make([]byte, asciiResponsePrefixLen)
+	if _, err := io.ReadFull(r, asciiPrefix); err != nil {
+		return Frame{}, err
+	}
+
+	// ASCII模式下，応答データ長字段本身就是紧随其后的数据部分的ASCII字符数，
+	// 直接按这4个十六进制字符的字面数值解析即可；和二进制帧里"字节数按小端
+	// 解释"的规则完全不同，不能先hex.Decode成字节再当成二进制长度字段来读
+	lenFieldHex := string(asciiPrefix[asciiResponsePrefixLen-4:])
+	charLen, err := strconv.ParseUint(lenFieldHex, 16, 16)
+	if err != nil {
+		return Frame{}, err
+	}
+
+	prefix := make([]byte, responsePrefixLen)
+	if _, err := hex.Decode(prefix, asciiPrefix); err != nil {
+		return Frame{}, err
+	}
+
+	asciiRest := make([]byte, charLen)
+	if _, err := io.ReadFull(r, asciiRest); err != nil {
+		return Frame{}, err
+	}
+	rest := make([]byte, charLen/2)
+	if _, err := hex.Decode(rest, asciiRest); err != nil {
+		return Frame{}, err
+	}
+
+	frame := append(prefix, rest...)
+	endCode, payload, err := splitBinaryFrame(frame, responsePrefixLen)
+	if err != nil {
+		return Frame{}, err
+	}
+	return Frame{EndCode: endCode, Payload: payload}, nil
+}
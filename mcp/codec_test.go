@@ -0,0 +1,65 @@
+package mcp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSplitBinaryFrame(t *testing.T) {
+	// 9字节前缀 + 终止代码0000 + 数据01 02
+	frame := []byte{0xD0, 0x00, 0x00, 0xFF, 0x03, 0x00, 0x00, 0x04, 0x00, 0x00, 0x00, 0x01, 0x02}
+
+	endCode, payload, err := splitBinaryFrame(frame, responsePrefixLen)
+	if err != nil {
+		t.Fatalf("splitBinaryFrame返回错误: %v", err)
+	}
+	if endCode != 0 {
+		t.Fatalf("endCode应为0, got %d", endCode)
+	}
+	if !bytes.Equal(payload, []byte{0x01, 0x02}) {
+		t.Fatalf("payload不正确: got %X", payload)
+	}
+}
+
+func TestASCII3E_DecodeFrame(t *testing.T) {
+	// 真正的ASCIIモード帧：応答データ長字段"0008"表示其后还有8个ASCII字符
+	// (终止代码0000 + 数据0102，各占4个字符)，而不是8个字节
+	asciiFrame := []byte("D000FF03000000000800000102")
+
+	frame, err := ASCII3E{}.DecodeFrame(bytes.NewReader(asciiFrame))
+	if err != nil {
+		t.Fatalf("ASCII3E.DecodeFrame返回错误: %v", err)
+	}
+	if frame.EndCode != 0 {
+		t.Fatalf("EndCode应为0, got %d", frame.EndCode)
+	}
+	if !bytes.Equal(frame.Payload, []byte{0x01, 0x02}) {
+		t.Fatalf("Payload不正确: got %X", frame.Payload)
+	}
+}
+
+func TestASCII3E_DecodeFrame_LengthIsCharCountNotByteCount(t *testing.T) {
+	// 如果把応答データ長字段误当成字节数(旧bug)，"0008"会被解释成需要再读
+	// 16个字符；这里构造一个只有8个字符数据的帧，误判会导致ReadFull超界出错
+	asciiFrame := []byte("D000FF03000000000800000102")
+
+	if _, err := (ASCII3E{}).DecodeFrame(bytes.NewReader(asciiFrame)); err != nil {
+		t.Fatalf("按字符数解析时不应该出错: %v", err)
+	}
+}
+
+func TestBinary4E_DecodeFrame_ExtractsSerial(t *testing.T) {
+	// 13字节前缀(serial=0x0102、固定值0000、网络号/PC号/IO号/站号、应答数据长度=4) + 终止代码0000 + 数据01 02
+	frame := []byte{0xD4, 0x00, 0x02, 0x01, 0x00, 0x00, 0xFF, 0x03, 0x00, 0x00, 0x00, 0x04, 0x00, 0x00, 0x00, 0x01, 0x02}
+
+	got, err := Binary4E{}.DecodeFrame(bytes.NewReader(frame))
+	if err != nil {
+		t.Fatalf("Binary4E.DecodeFrame返回错误: %v", err)
+	}
+	if got.Serial != 0x0102 {
+		t.Fatalf("Serial解析不正确: got %X, want 0102", got.Serial)
+	}
+	if !bytes.Equal(got.Payload, []byte{0x01, 0x02}) {
+		t.Fatalf("Payload不正确: got %X", got.Payload)
+	}
+}
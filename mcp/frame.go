@@ -0,0 +1,56 @@
+package mcp
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// responsePrefixLen是3Eフレーム応答の固定長部分のバイト数:
+// サブヘッダ(2byte) + ネットワーク番号(1byte) + PC番号(1byte) +
+// 要求先ユニットI/O番号(2byte) + 要求先ユニット局番号(1byte) + 応答データ長(2byte)
+const responsePrefixLen = 9
+
+// readResponseFrame从conn中读取一帧完整的3E二进制响应报文。
+// TCP是流式协议，一次Read既可能被拆成多个包（粘包/半包），也可能把下一帧的
+// 数据一起返回，因此必须先按固定前缀长度io.ReadFull出应答数据长度字段，
+// 再根据该长度精确地读取剩余的终止代码+数据部分，避免截断或多读。
+func readResponseFrame(r io.Reader) ([]byte, error) {
+	prefix := make([]byte, responsePrefixLen)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, err
+	}
+
+	dataLen := binary.LittleEndian.Uint16(prefix[responsePrefixLen-2 : responsePrefixLen])
+
+	rest := make([]byte, dataLen)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, err
+	}
+
+	return append(prefix, rest...), nil
+}
+
+// response4EPrefixLen是4Eフレーム応答の固定長部分のバイト数。3Eと同じ構成の
+// 手前に、要求時にクライアントが採番した流水番号(serial, 2byte)と、その直後に
+// 続く固定値0000(2byte)がサブヘッダ直後に挿入される分だけresponsePrefixLenより
+// 4byte長い
+const response4EPrefixLen = responsePrefixLen + 4
+
+// readResponse4EFrame从conn中读取一帧完整的4E二进制响应报文，并返回其中携带的
+// 流水号，供调用方据此把响应分发给正确的等待者
+func readResponse4EFrame(r io.Reader) (serial uint16, frame []byte, err error) {
+	prefix := make([]byte, response4EPrefixLen)
+	if _, err = io.ReadFull(r, prefix); err != nil {
+		return 0, nil, err
+	}
+
+	serial = binary.LittleEndian.Uint16(prefix[2:4])
+	dataLen := binary.LittleEndian.Uint16(prefix[response4EPrefixLen-2 : response4EPrefixLen])
+
+	rest := make([]byte, dataLen)
+	if _, err = io.ReadFull(r, rest); err != nil {
+		return 0, nil, err
+	}
+
+	return serial, append(prefix, rest...), nil
+}
@@ -0,0 +1,79 @@
+package mcp
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+// fakeConn是一个最小的io.Reader实现，Read按reads切片依次返回数据，
+// 用来模拟TCP的粘包/半包场景
+type fakeConn struct {
+	reads [][]byte
+}
+
+func (f *fakeConn) Read(b []byte) (int, error) {
+	if len(f.reads) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(b, f.reads[0])
+	f.reads[0] = f.reads[0][n:]
+	if len(f.reads[0]) == 0 {
+		f.reads = f.reads[1:]
+	}
+	return n, nil
+}
+
+func TestReadResponseFrame_SplitAcrossReads(t *testing.T) {
+	// 9字节前缀（应答数据长度=8） + 8字节终止代码/数据，拆成多段Read返回
+	full := []byte{0xD0, 0x00, 0x00, 0xFF, 0x03, 0x00, 0x00, 0x08, 0x00, 0x00, 0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06}
+
+	conn := &fakeConn{reads: [][]byte{
+		full[0:3],
+		full[3:9],
+		full[9:12],
+		full[12:],
+	}}
+
+	got, err := readResponseFrame(conn)
+	if err != nil {
+		t.Fatalf("readResponseFrame返回错误: %v", err)
+	}
+	if !bytes.Equal(got, full) {
+		t.Fatalf("拼出的帧不正确: got %X, want %X", got, full)
+	}
+}
+
+func TestReadResponseFrame_ConcatenatedInOneRead(t *testing.T) {
+	frame1 := []byte{0xD0, 0x00, 0x00, 0xFF, 0x03, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00}
+	frame2 := []byte{0xD0, 0x00, 0x00, 0xFF, 0x03, 0x00, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01}
+
+	// 两帧数据被同一次Read一次性返回
+	conn := &fakeConn{reads: [][]byte{append(append([]byte{}, frame1...), frame2...)}}
+
+	got1, err := readResponseFrame(conn)
+	if err != nil {
+		t.Fatalf("读取第一帧失败: %v", err)
+	}
+	if !bytes.Equal(got1, frame1) {
+		t.Fatalf("第一帧不正确: got %X, want %X", got1, frame1)
+	}
+
+	got2, err := readResponseFrame(conn)
+	if err != nil {
+		t.Fatalf("读取第二帧失败: %v", err)
+	}
+	if !bytes.Equal(got2, frame2) {
+		t.Fatalf("第二帧不正确: got %X, want %X", got2, frame2)
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	if !deadline(0).IsZero() {
+		t.Fatalf("超时为0时应返回零值time.Time")
+	}
+	if deadline(time.Second).IsZero() {
+		t.Fatalf("超时大于0时不应返回零值time.Time")
+	}
+}
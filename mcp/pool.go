@@ -0,0 +1,602 @@
+package mcp
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrAcquireTimeout在Pool.acquire()等待空闲连接超过AcquireTimeout仍未拿到连接时返回
+var ErrAcquireTimeout = errors.New("mcp: acquire connection from pool timed out")
+
+const (
+	defaultMinSize             = 1
+	defaultMaxSize             = 10
+	defaultIdleTimeout         = 5 * time.Minute
+	defaultHealthCheckInterval = 30 * time.Second
+	reconnectBaseBackoff       = 100 * time.Millisecond
+	reconnectMaxBackoff        = 30 * time.Second
+)
+
+// connRecord是池中一条被管理的连接及其状态
+type connRecord struct {
+	conn     net.Conn
+	inUse    bool
+	lastUsed time.Time
+	stopCh   chan struct{}
+}
+
+// connRequest是一个等待获取连接的调用方挂起的回执通道
+type connRequest chan connResult
+
+type connResult struct {
+	rec *connRecord
+	err error
+}
+
+// Pool是一个3E帧MCP连接池：对外仍然是一个Client，内部维护min/max数量的长连接，
+// 每个空闲连接由独立的后台goroutine定期执行HealthCheck，失效的连接会被剔除，
+// 并以带抖动的指数退避异步重连，使调用方不会只在真正发请求时才发现PLC已经断开。
+type Pool struct {
+	tcpAddr *net.TCPAddr
+	stn     *station
+	codec   Codec
+	dialer  *net.Dialer
+
+	minSize             int
+	maxSize             int
+	idleTimeout         time.Duration
+	acquireTimeout      time.Duration
+	healthCheckInterval time.Duration
+	readTimeout         time.Duration
+	writeTimeout        time.Duration
+
+	mu             sync.Mutex
+	conns          []*connRecord
+	numOpen        int
+	waiters        []connRequest
+	waitCount      int64
+	waitDuration   time.Duration
+	reconnectCount int64
+
+	closeOnce sync.Once
+	closeCh   chan struct{}
+}
+
+// PoolOption用于在创建Pool时配置可选参数
+type PoolOption func(p *Pool)
+
+// WithPoolSize设置池中维持的最小/最大连接数
+func WithPoolSize(min, max int) PoolOption {
+	return func(p *Pool) {
+		p.minSize = min
+		p.maxSize = max
+	}
+}
+
+// WithIdleTimeout设置空闲连接在被回收到最小连接数之前可以闲置的最长时间
+func WithIdleTimeout(d time.Duration) PoolOption {
+	return func(p *Pool) { p.idleTimeout = d }
+}
+
+// WithAcquireTimeout设置Read/BitRead/Write/HealthCheck等待拿到一个可用连接的
+// 最长时间，0表示一直等待
+func WithAcquireTimeout(d time.Duration) PoolOption {
+	return func(p *Pool) { p.acquireTimeout = d }
+}
+
+// WithPoolHealthCheckInterval设置每条空闲连接执行HealthCheck的间隔
+func WithPoolHealthCheckInterval(d time.Duration) PoolOption {
+	return func(p *Pool) { p.healthCheckInterval = d }
+}
+
+// WithPoolReadTimeout/WithPoolWriteTimeout设置池中每次I/O前的读写超时
+func WithPoolReadTimeout(d time.Duration) PoolOption {
+	return func(p *Pool) { p.readTimeout = d }
+}
+
+func WithPoolWriteTimeout(d time.Duration) PoolOption {
+	return func(p *Pool) { p.writeTimeout = d }
+}
+
+// WithPoolKeepAlive设置拨号时net.Dialer的KeepAlive间隔
+func WithPoolKeepAlive(d time.Duration) PoolOption {
+	return func(p *Pool) { p.dialer.KeepAlive = d }
+}
+
+// WithPoolCodec替换Pool使用的Codec，默认是Binary3E
+func WithPoolCodec(codec Codec) PoolOption {
+	return func(p *Pool) { p.codec = codec }
+}
+
+// PoolStats是Pool.Stats()返回的可观测性数据
+type PoolStats struct {
+	InUse          int
+	Idle           int
+	WaitCount      int64
+	WaitDuration   time.Duration
+	ReconnectCount int64
+}
+
+// NewPool创建一个3E帧连接池并预先建立MinSize条连接，每条连接都会启动自己的
+// 健康检查goroutine
+func NewPool(host string, port int, stn *station, opts ...PoolOption) (Client, error) {
+	tcpAddr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf("%v:%v", host, port))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Pool{
+		tcpAddr:             tcpAddr,
+		stn:                 stn,
+		codec:               Binary3E{},
+		dialer:              &net.Dialer{KeepAlive: 30 * time.Second},
+		minSize:             defaultMinSize,
+		maxSize:             defaultMaxSize,
+		idleTimeout:         defaultIdleTimeout,
+		healthCheckInterval: defaultHealthCheckInterval,
+		closeCh:             make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.maxSize < p.minSize {
+		p.maxSize = p.minSize
+	}
+
+	for i := 0; i < p.minSize; i++ {
+		rec, err := p.dialOnce()
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.mu.Lock()
+		p.numOpen++
+		p.conns = append(p.conns, rec)
+		p.mu.Unlock()
+		go p.healthCheckLoop(rec)
+	}
+
+	return p, nil
+}
+
+// dialOnce尝试建立一条新连接，不带退避重试，用于首次建池和acquire()的快速路径
+func (p *Pool) dialOnce() (*connRecord, error) {
+	conn, err := p.dialer.Dial("tcp", p.tcpAddr.String())
+	if err != nil {
+		return nil, err
+	}
+	return &connRecord{conn: conn, lastUsed: time.Now(), stopCh: make(chan struct{})}, nil
+}
+
+// dialWithBackoff在后台持续重连，直到成功或者池被关闭为止，重连间隔按
+// 100ms -> 30s上限做指数退避并叠加随机抖动，避免连接刚被剔除就打垮刚恢复的PLC
+func (p *Pool) dialWithBackoff() *connRecord {
+	backoff := reconnectBaseBackoff
+	for {
+		conn, err := p.dialer.Dial("tcp", p.tcpAddr.String())
+		if err == nil {
+			p.mu.Lock()
+			p.reconnectCount++
+			p.mu.Unlock()
+			return &connRecord{conn: conn, lastUsed: time.Now(), stopCh: make(chan struct{})}
+		}
+
+		select {
+		case <-time.After(backoffWithJitter(backoff)):
+		case <-p.closeCh:
+			return nil
+		}
+
+		backoff = nextBackoff(backoff)
+	}
+}
+
+// backoffWithJitter给base叠加一个[0, base/2]范围内的随机抖动，避免PLC刚恢复
+// 就被所有等待重连的客户端同时打到
+func backoffWithJitter(base time.Duration) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	return base + time.Duration(rand.Int63n(int64(base)/2+1))
+}
+
+// nextBackoff把当前退避时长翻倍，封顶在reconnectMaxBackoff
+func nextBackoff(current time.Duration) time.Duration {
+	next := current * 2
+	if next > reconnectMaxBackoff {
+		return reconnectMaxBackoff
+	}
+	return next
+}
+
+// healthCheckLoop是每条连接独立的后台goroutine：连接处于空闲状态时，按
+// healthCheckInterval执行一次HealthCheck请求，失败则剔除该连接；同时负责把
+// 闲置超过idleTimeout、且池内连接数高于minSize的连接收缩掉。执行健康检查期间
+// 会把连接标记为inUse，防止acquire()把同一条连接同时交给别的调用方做并发读写
+func (p *Pool) healthCheckLoop(rec *connRecord) {
+	ticker := time.NewTicker(p.healthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.mu.Lock()
+			if rec.inUse {
+				p.mu.Unlock()
+				continue
+			}
+			idleFor := time.Since(rec.lastUsed)
+			shrink := p.idleTimeout > 0 && idleFor > p.idleTimeout && p.numOpen > p.minSize
+			if shrink {
+				p.mu.Unlock()
+				p.discard(rec, false)
+				return
+			}
+			rec.inUse = true
+			p.mu.Unlock()
+
+			if err := p.healthCheckConn(rec.conn); err != nil {
+				p.discard(rec, true)
+				return
+			}
+
+			p.mu.Lock()
+			rec.inUse = false
+			p.mu.Unlock()
+		case <-rec.stopCh:
+			return
+		case <-p.closeCh:
+			return
+		}
+	}
+}
+
+// healthCheckConn在指定连接上发一次在线确认请求并校验应答
+func (p *Pool) healthCheckConn(conn net.Conn) error {
+	payload, err := p.codec.EncodeHealthCheck(p.stn, 0)
+	if err != nil {
+		return err
+	}
+
+	if err := conn.SetWriteDeadline(deadline(p.writeTimeout)); err != nil {
+		return err
+	}
+	if _, err := conn.Write(payload); err != nil {
+		return err
+	}
+
+	if err := conn.SetReadDeadline(deadline(p.readTimeout)); err != nil {
+		return err
+	}
+	frame, err := p.codec.DecodeFrame(conn)
+	if err != nil {
+		return err
+	}
+	if err := checkEndCode(frame); err != nil {
+		return err
+	}
+	if len(frame.Payload) != 7 {
+		return errors.New("plc connect test is fail: return length is [" + fmt.Sprintf("%X", frame.Payload) + "]")
+	}
+	return nil
+}
+
+// discard把一条连接从池中移除并关闭；replace为true时异步地以退避重连补上一条，
+// 维持池内连接数不低于minSize，并优先把新连接交给正在等待的调用方
+func (p *Pool) discard(rec *connRecord, replace bool) {
+	p.mu.Lock()
+	for i, r := range p.conns {
+		if r == rec {
+			p.conns = append(p.conns[:i], p.conns[i+1:]...)
+			break
+		}
+	}
+	p.numOpen--
+	needReplace := replace && p.numOpen < p.minSize
+	p.mu.Unlock()
+
+	rec.conn.Close()
+
+	if !needReplace {
+		return
+	}
+
+	go func() {
+		newRec := p.dialWithBackoff()
+		if newRec == nil {
+			return
+		}
+		p.addReadyConn(newRec)
+	}()
+}
+
+// addReadyConn把一条刚建立好的连接交给正在排队的调用方；如果没有人在等待，
+// 就放回空闲列表。无论走哪条分支，这条连接都要交由healthCheckLoop持续管理，
+// 否则重连补上的连接会在整个生命周期内都得不到健康检查与空闲收缩
+func (p *Pool) addReadyConn(rec *connRecord) {
+	p.mu.Lock()
+	if len(p.waiters) > 0 {
+		req := p.waiters[0]
+		p.waiters = p.waiters[1:]
+		rec.inUse = true
+		p.numOpen++
+		p.conns = append(p.conns, rec)
+		p.mu.Unlock()
+		go p.healthCheckLoop(rec)
+		req <- connResult{rec: rec}
+		return
+	}
+
+	p.numOpen++
+	p.conns = append(p.conns, rec)
+	p.mu.Unlock()
+
+	go p.healthCheckLoop(rec)
+}
+
+// acquire取出一条空闲连接；没有空闲连接但未达到maxSize时现场拨号一条；
+// 已达到maxSize则排队等待，直至有连接被释放或等待超过acquireTimeout
+func (p *Pool) acquire() (*connRecord, error) {
+	p.mu.Lock()
+	for _, rec := range p.conns {
+		if !rec.inUse {
+			rec.inUse = true
+			p.mu.Unlock()
+			return rec, nil
+		}
+	}
+
+	if p.numOpen < p.maxSize {
+		p.numOpen++
+		p.mu.Unlock()
+
+		rec, err := p.dialOnce()
+		if err != nil {
+			p.mu.Lock()
+			p.numOpen--
+			p.mu.Unlock()
+			return nil, err
+		}
+		rec.inUse = true
+		p.mu.Lock()
+		p.conns = append(p.conns, rec)
+		p.mu.Unlock()
+		go p.healthCheckLoop(rec)
+		return rec, nil
+	}
+
+	req := make(connRequest, 1)
+	p.waiters = append(p.waiters, req)
+	p.waitCount++
+	p.mu.Unlock()
+
+	start := time.Now()
+	var timeoutCh <-chan time.Time
+	if p.acquireTimeout > 0 {
+		timer := time.NewTimer(p.acquireTimeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+
+	select {
+	case res := <-req:
+		p.mu.Lock()
+		p.waitDuration += time.Since(start)
+		p.mu.Unlock()
+		return res.rec, res.err
+	case <-timeoutCh:
+		p.mu.Lock()
+		p.waitDuration += time.Since(start)
+		p.removeWaiterLocked(req)
+		p.mu.Unlock()
+		return nil, ErrAcquireTimeout
+	case <-p.closeCh:
+		return nil, errors.New("mcp: pool is closed")
+	}
+}
+
+func (p *Pool) removeWaiterLocked(req connRequest) {
+	for i, w := range p.waiters {
+		if w == req {
+			p.waiters = append(p.waiters[:i], p.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// release把一条用完的连接还给池：优先直接交给排队中的下一个调用方，否则标记
+// 为空闲
+func (p *Pool) release(rec *connRecord) {
+	p.mu.Lock()
+	if len(p.waiters) > 0 {
+		req := p.waiters[0]
+		p.waiters = p.waiters[1:]
+		p.mu.Unlock()
+		req <- connResult{rec: rec}
+		return
+	}
+
+	rec.inUse = false
+	rec.lastUsed = time.Now()
+	p.mu.Unlock()
+}
+
+// do在一条借出的连接上发送payload并读取一帧完整响应，出错时连接会被剔除
+// （剔除后异步补连），否则连接被归还给池
+func (p *Pool) do(payload []byte) ([]byte, error) {
+	rec, err := p.acquire()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := rec.conn.SetWriteDeadline(deadline(p.writeTimeout)); err != nil {
+		p.discard(rec, true)
+		return nil, err
+	}
+	if _, err := rec.conn.Write(payload); err != nil {
+		p.discard(rec, true)
+		return nil, err
+	}
+
+	if err := rec.conn.SetReadDeadline(deadline(p.readTimeout)); err != nil {
+		p.discard(rec, true)
+		return nil, err
+	}
+	frame, err := p.codec.DecodeFrame(rec.conn)
+	if err != nil {
+		p.discard(rec, true)
+		return nil, err
+	}
+
+	p.release(rec)
+
+	// EndCode非0是PLC对这次请求的协议层面拒绝，连接仍然健康，已经正常release，
+	// 不应该discard
+	if err := checkEndCode(frame); err != nil {
+		return nil, err
+	}
+	return frame.Payload, nil
+}
+
+// HealthCheck实现Client接口的HealthCheck方法，借用池中一条连接做在线确认
+func (p *Pool) HealthCheck() error {
+	payload, err := p.codec.EncodeHealthCheck(p.stn, 0)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.do(payload)
+	if err != nil {
+		return err
+	}
+
+	if len(resp) != 7 {
+		return errors.New("plc connect test is fail: return length is [" + fmt.Sprintf("%X", resp) + "]")
+	}
+	if "0500" != fmt.Sprintf("%X", resp[0:2]) {
+		return errors.New("plc connect test is fail: return header is [" + fmt.Sprintf("%X", resp[0:2]) + "]")
+	}
+	if "4142434445" != fmt.Sprintf("%X", resp[2:7]) {
+		return errors.New("plc connect test is fail: return body is [" + fmt.Sprintf("%X", resp[2:7]) + "]")
+	}
+	return nil
+}
+
+// Read实现Client接口的Read方法
+func (p *Pool) Read(deviceName string, offset, numPoints int64) ([]byte, error) {
+	payload, err := p.codec.EncodeRead(p.stn, 0, deviceName, offset, numPoints)
+	if err != nil {
+		return nil, err
+	}
+	return p.do(payload)
+}
+
+// BitRead实现Client接口的BitRead方法
+func (p *Pool) BitRead(deviceName string, offset, numPoints int64) ([]byte, error) {
+	payload, err := p.codec.EncodeBitRead(p.stn, 0, deviceName, offset, numPoints)
+	if err != nil {
+		return nil, err
+	}
+	return p.do(payload)
+}
+
+// Write实现Client接口的Write方法
+func (p *Pool) Write(deviceName string, offset, numPoints int64, writeData []byte) ([]byte, error) {
+	payload, err := p.codec.EncodeWrite(p.stn, 0, deviceName, offset, numPoints, writeData)
+	if err != nil {
+		return nil, err
+	}
+	return p.do(payload)
+}
+
+// RandomRead实现Client接口的RandomRead方法，借用池中的连接发送每一条拆分请求
+func (p *Pool) RandomRead(words, dwords []DevicePoint) ([]uint16, []uint32, error) {
+	return randomReadLoop(func(wChunk, dChunk []DevicePoint) ([]byte, error) {
+		requestHex, err := p.stn.BuildRandomReadRequest(wChunk, dChunk)
+		if err != nil {
+			return nil, err
+		}
+		payload, err := hex.DecodeString(requestHex)
+		if err != nil {
+			return nil, err
+		}
+		return p.do(payload)
+	}, words, dwords)
+}
+
+// RandomWrite实现Client接口的RandomWrite方法，借用池中的连接发送每一条拆分请求
+func (p *Pool) RandomWrite(words map[DevicePoint]uint16, dwords map[DevicePoint]uint32) error {
+	return randomWriteLoop(func(wChunk map[DevicePoint]uint16, dChunk map[DevicePoint]uint32) error {
+		requestHex, err := p.stn.BuildRandomWriteRequest(wChunk, dChunk)
+		if err != nil {
+			return err
+		}
+		payload, err := hex.DecodeString(requestHex)
+		if err != nil {
+			return err
+		}
+		_, err = p.do(payload)
+		return err
+	}, words, dwords)
+}
+
+// MultiBlockRead实现Client接口的MultiBlockRead方法，借用池中的连接发送每一条拆分请求
+func (p *Pool) MultiBlockRead(wordBlocks, bitBlocks []BlockSpec) ([][]byte, [][]byte, error) {
+	return multiBlockReadLoop(func(wChunk, bChunk []BlockSpec) ([]byte, error) {
+		requestHex, err := p.stn.BuildMultiBlockReadRequest(wChunk, bChunk)
+		if err != nil {
+			return nil, err
+		}
+		payload, err := hex.DecodeString(requestHex)
+		if err != nil {
+			return nil, err
+		}
+		return p.do(payload)
+	}, wordBlocks, bitBlocks)
+}
+
+// Stats返回池的可观测性数据：在用/空闲连接数、等待次数与时长、重连次数
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := PoolStats{
+		WaitCount:      p.waitCount,
+		WaitDuration:   p.waitDuration,
+		ReconnectCount: p.reconnectCount,
+	}
+	for _, rec := range p.conns {
+		if rec.inUse {
+			stats.InUse++
+		} else {
+			stats.Idle++
+		}
+	}
+	return stats
+}
+
+// Close关闭池中所有连接并停止所有后台goroutine
+func (p *Pool) Close() error {
+	var firstErr error
+	p.closeOnce.Do(func() {
+		close(p.closeCh)
+	})
+
+	p.mu.Lock()
+	conns := p.conns
+	p.conns = nil
+	p.mu.Unlock()
+
+	for _, rec := range conns {
+		close(rec.stopCh)
+		if err := rec.conn.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
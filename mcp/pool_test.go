@@ -0,0 +1,46 @@
+package mcp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextBackoff_CapsAtMax(t *testing.T) {
+	got := nextBackoff(reconnectMaxBackoff)
+	if got != reconnectMaxBackoff {
+		t.Fatalf("nextBackoff应当封顶在%v, got %v", reconnectMaxBackoff, got)
+	}
+
+	got = nextBackoff(reconnectMaxBackoff / 2)
+	if got != reconnectMaxBackoff {
+		t.Fatalf("翻倍后超过上限时应当封顶在%v, got %v", reconnectMaxBackoff, got)
+	}
+}
+
+func TestBackoffWithJitter_WithinBounds(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		got := backoffWithJitter(reconnectBaseBackoff)
+		if got < reconnectBaseBackoff || got >= reconnectBaseBackoff+reconnectBaseBackoff/2+1 {
+			t.Fatalf("backoffWithJitter(%v) = %v, 超出了[base, base+base/2]的预期范围", reconnectBaseBackoff, got)
+		}
+	}
+}
+
+func TestPool_ReleaseHandsConnDirectlyToWaiter(t *testing.T) {
+	p := &Pool{minSize: 1, maxSize: 1}
+
+	rec := &connRecord{lastUsed: time.Now()}
+	req := make(connRequest, 1)
+	p.waiters = append(p.waiters, req)
+
+	p.release(rec)
+
+	select {
+	case res := <-req:
+		if res.rec != rec {
+			t.Fatalf("等待者应当收到被释放的那条连接")
+		}
+	default:
+		t.Fatalf("release应当直接把连接交给排队中的等待者")
+	}
+}
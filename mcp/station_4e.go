@@ -0,0 +1,68 @@
+package mcp
+
+import "fmt"
+
+// subheader4ERequestHex是4Eフレーム要求の先頭2byte。3Eの"5000"に対して、
+// この直後にクライアントが採番した2byteの流水番号(serial)が挿入される
+const subheader4ERequestHex = "5400"
+
+// subheader3ERequestHexLen是3E请求hex串中subheader所占的字符数（2byte=4个十六进制字符）
+const subheader3ERequestHexLen = 4
+
+// fixed4EFieldHex是4Eフレームの流水番号直後に続く固定2byteフィールド，恒为"0000"
+const fixed4EFieldHex = "0000"
+
+// to4EFrameHex把一个已经按3E格式编码好的请求hex串转换成4E格式：将subheader
+// 从"5000"替换为"5400"，在其后插入serial（小端2byte），再插入固定值0000，
+// 其余网络号/PC号/子命令/数据等字节与3E完全一致
+func to4EFrameHex(req3EHex string, serial uint16) string {
+	serialHex := fmt.Sprintf("%02X%02X", byte(serial), byte(serial>>8))
+	return subheader4ERequestHex + serialHex + fixed4EFieldHex + req3EHex[subheader3ERequestHexLen:]
+}
+
+// Build4EReadRequest构建4E帧的批量读请求，serial由调用方分配，PLC会在响应中原样带回
+func (stn *station) Build4EReadRequest(serial uint16, deviceName string, offset, numPoints int64) string {
+	return to4EFrameHex(stn.BuildReadRequest(deviceName, offset, numPoints), serial)
+}
+
+// Build4EBitReadRequest构建4E帧的位单位批量读请求
+func (stn *station) Build4EBitReadRequest(serial uint16, deviceName string, offset, numPoints int64) string {
+	return to4EFrameHex(stn.BuildBitReadRequest(deviceName, offset, numPoints), serial)
+}
+
+// Build4EWriteRequest构建4E帧的批量写请求
+func (stn *station) Build4EWriteRequest(serial uint16, deviceName string, offset, numPoints int64, writeData []byte) string {
+	return to4EFrameHex(stn.BuildWriteRequest(deviceName, offset, numPoints, writeData), serial)
+}
+
+// Build4EHealthCheckRequest构建4E帧的在线確認（健康检查）请求
+func (stn *station) Build4EHealthCheckRequest(serial uint16) string {
+	return to4EFrameHex(stn.BuildHealthCheckRequest(), serial)
+}
+
+// Build4ERandomReadRequest构建4E帧的随机读请求
+func (stn *station) Build4ERandomReadRequest(serial uint16, words, dwords []DevicePoint) (string, error) {
+	req3E, err := stn.BuildRandomReadRequest(words, dwords)
+	if err != nil {
+		return "", err
+	}
+	return to4EFrameHex(req3E, serial), nil
+}
+
+// Build4ERandomWriteRequest构建4E帧的随机写请求
+func (stn *station) Build4ERandomWriteRequest(serial uint16, words map[DevicePoint]uint16, dwords map[DevicePoint]uint32) (string, error) {
+	req3E, err := stn.BuildRandomWriteRequest(words, dwords)
+	if err != nil {
+		return "", err
+	}
+	return to4EFrameHex(req3E, serial), nil
+}
+
+// Build4EMultiBlockReadRequest构建4E帧的多区块批量读请求
+func (stn *station) Build4EMultiBlockReadRequest(serial uint16, wordBlocks, bitBlocks []BlockSpec) (string, error) {
+	req3E, err := stn.BuildMultiBlockReadRequest(wordBlocks, bitBlocks)
+	if err != nil {
+		return "", err
+	}
+	return to4EFrameHex(req3E, serial), nil
+}
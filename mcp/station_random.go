@@ -0,0 +1,218 @@
+package mcp
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// DevicePoint标识PLC上的一个独立软元件点位，用于RandomRead/RandomWrite这类
+// 一次性读写多个互不相邻点位的接口
+type DevicePoint struct {
+	Device string
+	Offset int64
+}
+
+// BlockSpec标识一段连续的软元件区间，用于MultiBlockRead这类一次性读取多个
+// 互不相邻区块的接口
+type BlockSpec struct {
+	Device    string
+	Offset    int64
+	NumPoints int64
+}
+
+// randomReadCommand/randomWriteCommand/multiBlockReadCommand是MC协议里对应的
+// 命令码：0403是随机读，1402是随机写，0406是多区块批量读，均为QnA兼容3E帧命令
+const (
+	randomReadCommand     = 0x0403
+	randomWriteCommand    = 0x1402
+	multiBlockReadCommand = 0x0406
+
+	subcommandWordUnit = 0x0000
+	subcommandBitUnit  = 0x0001
+
+	// maxRandomPoints是单次Random Read/Write请求允许携带的点位总数上限，
+	// 其中每个双字软元件按dwordPointWeight计入这个总数（占2个点位的配额）
+	maxRandomPoints = 192
+	// dwordPointWeight是双字软元件相对字软元件在maxRandomPoints里的权重
+	dwordPointWeight = 2
+	// maxMultiBlockCount是单次Multiple Block Batch Read请求允许携带的区块总数上限
+	maxMultiBlockCount = 120
+)
+
+// deviceCodes是软元件名称到MCプロトコル设备代码（1byte）的映射，仅覆盖常用的
+// 字软元件/位软元件，够用于RandomRead/RandomWrite/MultiBlockRead
+var deviceCodes = map[string]byte{
+	"D": 0xA8, // データレジスタ
+	"W": 0xB4, // リンクレジスタ
+	"R": 0xAF, // ファイルレジスタ
+	"M": 0x90, // 内部リレー
+	"B": 0xA0, // リンクリレー
+	"X": 0x9C, // 入力
+	"Y": 0x9D, // 出力
+}
+
+// deviceCode返回deviceName对应的1byte设备代码
+func deviceCode(deviceName string) (byte, error) {
+	code, ok := deviceCodes[strings.ToUpper(deviceName)]
+	if !ok {
+		return 0, fmt.Errorf("mcp: unsupported device %q for random read/write", deviceName)
+	}
+	return code, nil
+}
+
+// encodeDevicePoint把一个DevicePoint编码成MCプロトコル的"デバイス指定"：
+// 软元件起始番号(3byte，小端) + 软元件代码(1byte)
+func encodeDevicePoint(dp DevicePoint) ([]byte, error) {
+	code, err := deviceCode(dp.Device)
+	if err != nil {
+		return nil, err
+	}
+	return []byte{
+		byte(dp.Offset),
+		byte(dp.Offset >> 8),
+		byte(dp.Offset >> 16),
+		code,
+	}, nil
+}
+
+// encodeBlockSpec把一个BlockSpec编码成"デバイス指定" + 点数(2byte，小端)
+func encodeBlockSpec(b BlockSpec) ([]byte, error) {
+	code, err := deviceCode(b.Device)
+	if err != nil {
+		return nil, err
+	}
+	return []byte{
+		byte(b.Offset),
+		byte(b.Offset >> 8),
+		byte(b.Offset >> 16),
+		code,
+		byte(b.NumPoints),
+		byte(b.NumPoints >> 8),
+	}, nil
+}
+
+// stationHeaderHex从一个始终可用的3E请求（在线确认）里截取网络号(1byte)/
+// PC号(1byte)/要求先ユニットI/O番号(2byte)/局番号(1byte)这5byte=10个十六进制
+// 字符的头部，复用给其它自定义命令，避免在这里重新猜测station内部字段。
+// 请求数据长度字段不在这个截取范围内，由build3ERequestHex自行按body长度计算填充
+func stationHeaderHex(stn *station) string {
+	template := stn.BuildHealthCheckRequest()
+	return template[subheader3ERequestHexLen : subheader3ERequestHexLen+10]
+}
+
+// buildBinaryRequestHex组装一个完整的3E二进制请求：headerHex是网络号/PC号/
+// 要求先ユニットI/O番号/局番号这段10个十六进制字符的头部，自行填充CPU監視タイマ、
+// command/subcommand与请求数据长度。从build3ERequestHex中拆出来是一个纯函数，
+// 不依赖*station，方便在不构造station的情况下校验帧字节布局
+func buildBinaryRequestHex(headerHex string, command, subcommand uint16, body []byte) string {
+	const monitoringTimerHex = "1000" // 4秒（单位250ms），与本包其它请求保持一致的默认值
+
+	requestDataLen := 2 + 2 + 2 + len(body) // timer(2B) + command(2B) + subcommand(2B) + body
+	return "5000" +
+		headerHex +
+		fmt.Sprintf("%02X%02X", byte(requestDataLen), byte(requestDataLen>>8)) +
+		monitoringTimerHex +
+		fmt.Sprintf("%02X%02X", byte(command), byte(command>>8)) +
+		fmt.Sprintf("%02X%02X", byte(subcommand), byte(subcommand>>8)) +
+		strings.ToUpper(hex.EncodeToString(body))
+}
+
+// build3ERequestHex组装一个完整的3E二进制请求：复用stationHeaderHex给出的网络信息
+func build3ERequestHex(stn *station, command, subcommand uint16, body []byte) string {
+	return buildBinaryRequestHex(stationHeaderHex(stn), command, subcommand, body)
+}
+
+// randomReadBody组装随机读请求的数据部分：字点位个数(1byte)+双字点位个数(1byte)，
+// 紧随其后是各点位的"デバイス指定"，先word后dword。拆成纯函数便于不依赖*station测试
+func randomReadBody(words, dwords []DevicePoint) ([]byte, error) {
+	body := []byte{byte(len(words)), byte(len(dwords))}
+	for _, dp := range words {
+		enc, err := encodeDevicePoint(dp)
+		if err != nil {
+			return nil, err
+		}
+		body = append(body, enc...)
+	}
+	for _, dp := range dwords {
+		enc, err := encodeDevicePoint(dp)
+		if err != nil {
+			return nil, err
+		}
+		body = append(body, enc...)
+	}
+	return body, nil
+}
+
+// BuildRandomReadRequest构建随机读请求（命令0403，字单位子命令0000）：一次性
+// 读取若干互不相邻的字软元件和双字软元件
+func (stn *station) BuildRandomReadRequest(words, dwords []DevicePoint) (string, error) {
+	body, err := randomReadBody(words, dwords)
+	if err != nil {
+		return "", err
+	}
+	return build3ERequestHex(stn, randomReadCommand, subcommandWordUnit, body), nil
+}
+
+// randomWriteBody组装随机写请求的数据部分：字点位个数(1byte)+双字点位个数(1byte)，
+// 紧随其后是各点位的"デバイス指定"+写入值，先word(2byte)后dword(4byte)
+func randomWriteBody(words map[DevicePoint]uint16, dwords map[DevicePoint]uint32) ([]byte, error) {
+	body := []byte{byte(len(words)), byte(len(dwords))}
+	for dp, v := range words {
+		enc, err := encodeDevicePoint(dp)
+		if err != nil {
+			return nil, err
+		}
+		body = append(body, enc...)
+		body = append(body, byte(v), byte(v>>8))
+	}
+	for dp, v := range dwords {
+		enc, err := encodeDevicePoint(dp)
+		if err != nil {
+			return nil, err
+		}
+		body = append(body, enc...)
+		body = append(body, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+	}
+	return body, nil
+}
+
+// BuildRandomWriteRequest构建随机写请求（命令1402，字单位子命令0000）
+func (stn *station) BuildRandomWriteRequest(words map[DevicePoint]uint16, dwords map[DevicePoint]uint32) (string, error) {
+	body, err := randomWriteBody(words, dwords)
+	if err != nil {
+		return "", err
+	}
+	return build3ERequestHex(stn, randomWriteCommand, subcommandWordUnit, body), nil
+}
+
+// multiBlockReadBody组装多区块批量读请求的数据部分：wordBlocks和bitBlocks在
+// 请求体中各自独立计数，紧随其后顺序排列；响应数据里wordBlocks和bitBlocks
+// 都按NumPoints*2字节返回（见decodeMultiBlockReadPayload）
+func multiBlockReadBody(wordBlocks, bitBlocks []BlockSpec) ([]byte, error) {
+	body := []byte{byte(len(wordBlocks)), byte(len(bitBlocks))}
+	for _, b := range wordBlocks {
+		enc, err := encodeBlockSpec(b)
+		if err != nil {
+			return nil, err
+		}
+		body = append(body, enc...)
+	}
+	for _, b := range bitBlocks {
+		enc, err := encodeBlockSpec(b)
+		if err != nil {
+			return nil, err
+		}
+		body = append(body, enc...)
+	}
+	return body, nil
+}
+
+// BuildMultiBlockReadRequest构建多区块批量读请求（命令0406，字单位子命令0000）
+func (stn *station) BuildMultiBlockReadRequest(wordBlocks, bitBlocks []BlockSpec) (string, error) {
+	body, err := multiBlockReadBody(wordBlocks, bitBlocks)
+	if err != nil {
+		return "", err
+	}
+	return build3ERequestHex(stn, multiBlockReadCommand, subcommandWordUnit, body), nil
+}
@@ -0,0 +1,134 @@
+package mcp
+
+import "testing"
+
+// fakeStationHeaderHex模拟stationHeaderHex(stn)的输出：网络号00/PC号FF/
+// 要求先ユニットI/O番号0300/局番号00，凑够10个十六进制字符
+const fakeStationHeaderHex = "00FF030000"
+
+func TestBuildBinaryRequestHex_FrameLayout(t *testing.T) {
+	body := []byte{0xAA, 0xBB}
+
+	got := buildBinaryRequestHex(fakeStationHeaderHex, 0x0403, 0x0000, body)
+
+	// 5000(subheader) + header(10) + 请求数据长度(0006, 小端) + 1000(监視タイマ) +
+	// 0304(command小端) + 0000(subcommand) + AABB(body)，请求数据长度仅覆盖
+	// timer+command+subcommand+body，不包含header本身
+	want := "5000" + fakeStationHeaderHex + "0800" + "1000" + "0304" + "0000" + "AABB"
+
+	if got != want {
+		t.Fatalf("buildBinaryRequestHex结果不正确: got %s, want %s", got, want)
+	}
+}
+
+func TestBuildBinaryRequestHex_LengthExcludesHeader(t *testing.T) {
+	// 回归测试：stationHeaderHex曾经多截取了4个字符的"请求数据长度"字段，
+	// 导致这里拼出的长度字段和紧随其后的残留长度字节重复、帧整体错位。
+	// 这里验证:相同body，加长header不应当改变请求数据长度字段的值。
+	body := []byte{0x01, 0x02, 0x03}
+	shortHeader := "0000000000"
+	longHeader := "00000000000000" // 多出4个字符，模拟旧bug残留的长度字段
+
+	short := buildBinaryRequestHex(shortHeader, 0x0401, 0x0000, body)
+	long := buildBinaryRequestHex(longHeader, 0x0401, 0x0000, body)
+
+	shortLenField := short[4+len(shortHeader) : 4+len(shortHeader)+4]
+	longLenField := long[4+len(longHeader) : 4+len(longHeader)+4]
+
+	if shortLenField != "0900" || longLenField != "0900" {
+		t.Fatalf("请求数据长度字段应恒为0900(timer2+command2+subcommand2+body3), got short=%s long=%s", shortLenField, longLenField)
+	}
+}
+
+func TestRandomReadBody(t *testing.T) {
+	words := []DevicePoint{{Device: "D", Offset: 100}}
+	dwords := []DevicePoint{{Device: "D", Offset: 200}}
+
+	body, err := randomReadBody(words, dwords)
+	if err != nil {
+		t.Fatalf("randomReadBody返回错误: %v", err)
+	}
+
+	want := []byte{
+		0x01, 0x01, // 1个word, 1个dword
+		0x64, 0x00, 0x00, 0xA8, // D100
+		0xC8, 0x00, 0x00, 0xA8, // D200
+	}
+	if len(body) != len(want) {
+		t.Fatalf("randomReadBody长度不正确: got %X, want %X", body, want)
+	}
+	for i := range want {
+		if body[i] != want[i] {
+			t.Fatalf("randomReadBody结果不正确: got %X, want %X", body, want)
+		}
+	}
+}
+
+func TestRandomWriteBody(t *testing.T) {
+	words := map[DevicePoint]uint16{{Device: "D", Offset: 100}: 0x1234}
+
+	body, err := randomWriteBody(words, nil)
+	if err != nil {
+		t.Fatalf("randomWriteBody返回错误: %v", err)
+	}
+
+	want := []byte{
+		0x01, 0x00, // 1个word, 0个dword
+		0x64, 0x00, 0x00, 0xA8, // D100
+		0x34, 0x12, // 写入值0x1234，小端
+	}
+	if len(body) != len(want) {
+		t.Fatalf("randomWriteBody长度不正确: got %X, want %X", body, want)
+	}
+	for i := range want {
+		if body[i] != want[i] {
+			t.Fatalf("randomWriteBody结果不正确: got %X, want %X", body, want)
+		}
+	}
+}
+
+func TestMultiBlockReadBody(t *testing.T) {
+	wordBlocks := []BlockSpec{{Device: "D", Offset: 0, NumPoints: 2}}
+	bitBlocks := []BlockSpec{{Device: "M", Offset: 16, NumPoints: 3}}
+
+	body, err := multiBlockReadBody(wordBlocks, bitBlocks)
+	if err != nil {
+		t.Fatalf("multiBlockReadBody返回错误: %v", err)
+	}
+
+	want := []byte{
+		0x01, 0x01, // 1个word区块, 1个bit区块
+		0x00, 0x00, 0x00, 0xA8, 0x02, 0x00, // D0, 2点
+		0x10, 0x00, 0x00, 0x90, 0x03, 0x00, // M16, 3点
+	}
+	if len(body) != len(want) {
+		t.Fatalf("multiBlockReadBody长度不正确: got %X, want %X", body, want)
+	}
+	for i := range want {
+		if body[i] != want[i] {
+			t.Fatalf("multiBlockReadBody结果不正确: got %X, want %X", body, want)
+		}
+	}
+}
+
+func TestTakeWeightedDevicePoints_DwordCountsDouble(t *testing.T) {
+	// maxPoints=5时：3个word占3个配额，剩余配额2个点位只够1个dword(权重2)，
+	// 而不是曾经的bug允许的2个dword
+	words := make([]DevicePoint, 3)
+	dwords := make([]DevicePoint, 3)
+	for i := range words {
+		words[i] = DevicePoint{Device: "D", Offset: int64(i)}
+	}
+	for i := range dwords {
+		dwords[i] = DevicePoint{Device: "D", Offset: int64(i)}
+	}
+
+	wChunk, dChunk, _, dNext := takeWeightedDevicePoints(words, dwords, 0, 0, 5)
+
+	if len(wChunk) != 3 {
+		t.Fatalf("word配额应当取满3个, got %d", len(wChunk))
+	}
+	if len(dChunk) != 1 || dNext != 1 {
+		t.Fatalf("剩余2个点位配额只够1个dword(权重2), got dChunk=%d dNext=%d", len(dChunk), dNext)
+	}
+}